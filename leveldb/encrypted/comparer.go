@@ -0,0 +1,31 @@
+package encrypted
+
+import (
+	"bytes"
+
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+)
+
+// Comparer orders encrypted keys the same way BytewiseComparator orders
+// plaintext ones: the prefix-preserving order-preserving encryption in
+// ope.go guarantees that lexicographic order over the encrypted prefix
+// matches lexicographic order over the plaintext prefix, so a plain byte
+// compare is all that is needed for the LSM machinery (compaction,
+// iteration, bloom filter placement) to keep working unmodified.
+//
+// Separator and Successor deliberately do not shorten their result the
+// way comparer.BytewiseComparator does: shortening relies on inspecting
+// bytes past the order-preserving prefix, which here are opaque
+// ciphertext, so there is no safe shorter value to pick. Falling back to
+// an exact copy of the bound is always correct, just not minimal.
+type Comparer struct{}
+
+var _ comparer.Comparer = Comparer{}
+
+func (Comparer) Compare(a, b []byte) int { return bytes.Compare(a, b) }
+
+func (Comparer) Name() string { return "leveldb.EncryptedBytewiseComparator" }
+
+func (Comparer) Separator(dst, a, b []byte) []byte { return append(dst, a...) }
+
+func (Comparer) Successor(dst, b []byte) []byte { return append(dst, b...) }
@@ -0,0 +1,323 @@
+// Package encrypted wraps a leveldb.DB so that user keys and values never
+// reach the write path in the clear. Values get ordinary authenticated
+// encryption; keys get a prefix-preserving, order-preserving transform
+// over a configurable number of leading bytes, so range iteration keeps
+// working, and an opaque authenticated encryption of everything after
+// that prefix. This intentionally still leaks key order (and, within a
+// configurable length bucket, approximate key/value lengths and SSTable
+// block boundaries) - encrypting the raw bytes in leveldb/storage hides
+// what is on disk, but not the LSM structure built on top of it; this
+// package is what closes that gap, at the cost of the leakage documented
+// above.
+package encrypted
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Options configures an encrypted DB. The zero value is valid and picks
+// storage.DefaultSuite(), an 8-byte order-preserving key prefix and a
+// 64-byte length bucket.
+type Options struct {
+	// Suite selects the AEAD used for both key suffixes and values.
+	Suite storage.AEADSuite
+	// PrefixLen is how many leading key bytes get order-preserving
+	// encryption; the rest of the key is opaque ciphertext. 0 selects the
+	// default (8); -1 disables order-preserving encryption entirely,
+	// which disables range iteration over meaningful prefixes.
+	PrefixLen int
+	// LengthBucket rounds encrypted key-suffix and value lengths up to
+	// the next multiple of this many bytes, to blur their exact length.
+	// 0 selects the default (64); -1 disables padding.
+	LengthBucket int
+}
+
+const (
+	defaultPrefixLen    = 8
+	defaultLengthBucket = 64
+)
+
+func (o *Options) withDefaults() *Options {
+	r := Options{}
+	if o != nil {
+		r = *o
+	}
+	if r.Suite == nil {
+		r.Suite = storage.DefaultSuite()
+	}
+	switch {
+	case r.PrefixLen == 0:
+		r.PrefixLen = defaultPrefixLen
+	case r.PrefixLen < 0:
+		r.PrefixLen = 0
+	}
+	switch {
+	case r.LengthBucket == 0:
+		r.LengthBucket = defaultLengthBucket
+	case r.LengthBucket < 0:
+		r.LengthBucket = 0
+	}
+	return &r
+}
+
+// DB wraps a *leveldb.DB, transparently encrypting every key and value
+// that crosses Put, Get, Delete and iterators.
+type DB struct {
+	*leveldb.DB
+
+	aead         cipher.AEAD
+	keyHMACKey   []byte
+	prefixLen    int
+	lengthBucket int
+
+	opeTables [][256]uint16
+	opeInv    []map[uint16]byte
+}
+
+// Open opens (or creates) an encrypted database backed by stor, deriving
+// separate subkeys for key and value encryption from key.
+func Open(stor storage.Storage, key []byte, o *Options) (*DB, error) {
+	opts := o.withDefaults()
+
+	valueKey := deriveSubkey(key, "leveldb-encrypted-value", opts.Suite.KeySize())
+	aead, err := opts.Suite.New(valueKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init %s: %s", opts.Suite.Name(), err)
+	}
+	opeKey := deriveSubkey(key, "leveldb-encrypted-ope", 32)
+	keyHMACKey := deriveSubkey(key, "leveldb-encrypted-key-nonce", 32)
+
+	db := &DB{
+		aead:         aead,
+		keyHMACKey:   keyHMACKey,
+		prefixLen:    opts.PrefixLen,
+		lengthBucket: opts.LengthBucket,
+		opeTables:    make([][256]uint16, opts.PrefixLen),
+		opeInv:       make([]map[uint16]byte, opts.PrefixLen),
+	}
+	for i := 0; i < opts.PrefixLen; i++ {
+		db.opeTables[i] = opeTable(opeKey, i)
+		db.opeInv[i] = invertOPETable(db.opeTables[i])
+	}
+
+	ldb, err := leveldb.Open(stor, &opt.Options{Comparer: Comparer{}})
+	if err != nil {
+		return nil, err
+	}
+	db.DB = ldb
+	return db, nil
+}
+
+func deriveSubkey(key []byte, label string, size int) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	sum := mac.Sum(nil)
+	if size <= len(sum) {
+		return sum[:size]
+	}
+	// Only reachable for key sizes longer than SHA-256's output, which no
+	// supported AEADSuite needs today.
+	out := make([]byte, size)
+	copy(out, sum)
+	return out
+}
+
+// encryptKey deterministically maps a plaintext key to its on-disk form:
+// an order-preserving encryption of the first prefixLen bytes, followed by
+// an authenticated encryption of everything after that.
+//
+// The OPE part always occupies exactly prefixLen*2 bytes, regardless of
+// len(plain): positions past the end of a short key are encoded as 0x0000
+// rather than simply omitted. Comparer compares the whole encoded
+// key with a plain bytes.Compare, so a length-dependent prefix would let
+// that length - not the OPE-encoded bytes - decide the comparison for any
+// pair of differently-sized keys, defeating the entire scheme. 0x0000 is
+// safe as an "absent" marker because every present byte encodes through
+// opeTable's cumulative sum, whose first entry is already >= 1 (see
+// ope.go), so it never collides with a real encoded position; it also
+// sorts before any real position, matching bytes.Compare's own rule that a
+// genuine prefix of a longer key is the lesser one.
+func (db *DB) encryptKey(plain []byte) []byte {
+	n := db.prefixLen
+	if n > len(plain) {
+		n = len(plain)
+	}
+	suffix := plain[n:]
+
+	opePrefix := make([]byte, db.prefixLen*2)
+	for i := 0; i < n; i++ {
+		v := db.opeTables[i][plain[i]]
+		opePrefix[2*i], opePrefix[2*i+1] = byte(v>>8), byte(v)
+	}
+
+	nonce := db.keyNonce(plain)
+	sealed := db.aead.Seal(nil, nonce, padToBucket(suffix, db.lengthBucket), opePrefix)
+
+	out := make([]byte, 0, len(opePrefix)+len(nonce)+len(sealed))
+	out = append(out, opePrefix...)
+	out = append(out, nonce...)
+	out = append(out, sealed...)
+	return out
+}
+
+// keyNonce derives a nonce from the whole plaintext key via HMAC, rather
+// than drawing one at random, so that encryptKey is deterministic: the
+// same plaintext key always produces the same stored key, which Get and
+// Delete depend on to find what Put wrote.
+func (db *DB) keyNonce(plain []byte) []byte {
+	mac := hmac.New(sha256.New, db.keyHMACKey)
+	mac.Write(plain)
+	return mac.Sum(nil)[:db.aead.NonceSize()]
+}
+
+func (db *DB) decryptKey(enc []byte) ([]byte, error) {
+	prefixBytes := db.prefixLen * 2
+	if len(enc) < prefixBytes {
+		return nil, fmt.Errorf("encrypted: truncated key prefix")
+	}
+	opePrefix, rest := enc[:prefixBytes], enc[prefixBytes:]
+
+	// A 0x0000 slot marks the end of the real prefix (see encryptKey); stop
+	// decoding there rather than treating it as an encoded zero byte.
+	plain := make([]byte, 0, db.prefixLen)
+	for i := 0; i < db.prefixLen; i++ {
+		v := uint16(opePrefix[2*i])<<8 | uint16(opePrefix[2*i+1])
+		if v == 0 {
+			break
+		}
+		b, ok := db.opeInv[i][v]
+		if !ok {
+			return nil, fmt.Errorf("encrypted: key prefix byte %d not in OPE table", i)
+		}
+		plain = append(plain, b)
+	}
+
+	ns := db.aead.NonceSize()
+	if len(rest) < ns {
+		return nil, fmt.Errorf("encrypted: truncated key nonce")
+	}
+	nonce, sealed := rest[:ns], rest[ns:]
+	padded, err := db.aead.Open(nil, nonce, sealed, opePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted: key authentication failed: %s", err)
+	}
+	return append(plain, unpad(padded)...), nil
+}
+
+func (db *DB) encryptValue(plain []byte) ([]byte, error) {
+	nonce := make([]byte, db.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %s", err)
+	}
+	sealed := db.aead.Seal(nonce, nonce, padToBucket(plain, db.lengthBucket), nil)
+	return sealed, nil
+}
+
+func (db *DB) decryptValue(enc []byte) ([]byte, error) {
+	ns := db.aead.NonceSize()
+	if len(enc) < ns {
+		return nil, fmt.Errorf("encrypted: truncated value")
+	}
+	nonce, sealed := enc[:ns], enc[ns:]
+	padded, err := db.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted: value authentication failed: %s", err)
+	}
+	return unpad(padded), nil
+}
+
+func (db *DB) Put(key, value []byte, wo *opt.WriteOptions) error {
+	ev, err := db.encryptValue(value)
+	if err != nil {
+		return err
+	}
+	return db.DB.Put(db.encryptKey(key), ev, wo)
+}
+
+func (db *DB) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	ev, err := db.DB.Get(db.encryptKey(key), ro)
+	if err != nil {
+		return nil, err
+	}
+	return db.decryptValue(ev)
+}
+
+func (db *DB) Delete(key []byte, wo *opt.WriteOptions) error {
+	return db.DB.Delete(db.encryptKey(key), wo)
+}
+
+// NewIterator wraps the underlying iterator so Key() and Value() return
+// decrypted bytes on the fly; slice bounds, if given, are encrypted the
+// same way Put encrypts keys. A nil Start or Limit means "unbounded" in
+// *util.Range (util.BytesPrefix leaves Limit nil for a prefix made only of
+// 0xff bytes) and must stay nil rather than become encryptKey(nil), which is a
+// concrete byte string like any other, not a sentinel for "no bound".
+func (db *DB) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	var encSlice *util.Range
+	if slice != nil {
+		encSlice = &util.Range{}
+		if slice.Start != nil {
+			encSlice.Start = db.encryptKey(slice.Start)
+		}
+		if slice.Limit != nil {
+			encSlice.Limit = db.encryptKey(slice.Limit)
+		}
+	}
+	return &decryptingIterator{Iterator: db.DB.NewIterator(encSlice, ro), db: db}
+}
+
+// decryptingIterator decrypts keys and values on the fly. A decryption or
+// authentication failure is not silently swallowed into an empty result:
+// it is latched in err, which both Valid() and Error() report, the same
+// way a corrupted block surfaces as an error rather than garbage bytes in
+// leveldb/storage.
+type decryptingIterator struct {
+	iterator.Iterator
+	db  *DB
+	err error
+}
+
+func (it *decryptingIterator) Key() []byte {
+	if it.err != nil {
+		return nil
+	}
+	k, err := it.db.decryptKey(it.Iterator.Key())
+	if err != nil {
+		it.err = err
+		return nil
+	}
+	return k
+}
+
+func (it *decryptingIterator) Value() []byte {
+	if it.err != nil {
+		return nil
+	}
+	v, err := it.db.decryptValue(it.Iterator.Value())
+	if err != nil {
+		it.err = err
+		return nil
+	}
+	return v
+}
+
+func (it *decryptingIterator) Valid() bool {
+	return it.err == nil && it.Iterator.Valid()
+}
+
+func (it *decryptingIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.Iterator.Error()
+}
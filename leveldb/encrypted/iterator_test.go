@@ -0,0 +1,99 @@
+package encrypted
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// TestIteratorSurfacesDecryptError is a regression test for
+// decryptingIterator silently returning nil from Key()/Value() on a
+// decryption or authentication failure instead of surfacing it: the
+// caller had no way to tell a tampered entry apart from a genuinely empty
+// one, and Error() kept reporting the underlying iterator's nil error.
+func TestIteratorSurfacesDecryptError(t *testing.T) {
+	stor := storage.NewMemStorage()
+	db, err := Open(stor, []byte("0123456789abcdef0123456789abcdef"), nil)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+
+	if err := db.Put([]byte("good"), []byte("value"), nil); err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+	if err := db.DB.Put(db.encryptKey([]byte("bad")), []byte("not a valid sealed value"), nil); err != nil {
+		t.Fatalf("Put (raw): %s", err)
+	}
+	db.Close()
+
+	db, err = Open(stor, []byte("0123456789abcdef0123456789abcdef"), nil)
+	if err != nil {
+		t.Fatalf("reopen: %s", err)
+	}
+	defer db.Close()
+
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	var sawErr bool
+	for it.Next() {
+		if it.Value() == nil && it.Error() != nil {
+			sawErr = true
+			break
+		}
+	}
+	if !sawErr {
+		t.Fatalf("expected iterator to surface a decryption error via Error(), got none (Valid=%v, Error=%v)", it.Valid(), it.Error())
+	}
+	if it.Valid() {
+		t.Fatalf("expected Valid() to be false once a decryption error is latched")
+	}
+}
+
+// TestNewIteratorUnboundedLimit is a regression test for NewIterator
+// encrypting a nil Start/Limit into encryptKey(nil) - a concrete byte
+// string whose all-zero OPE prefix sorts below every non-empty key - rather
+// than leaving it nil, the *util.Range sentinel for "no bound". It
+// reproduces the shape of the range util.BytesPrefix returns for a prefix
+// made only of 0xff bytes, whose Limit is nil: such a scan must still
+// return every key from Start onward, not the empty result a Limit of
+// encryptKey(nil) would give.
+func TestNewIteratorUnboundedLimit(t *testing.T) {
+	db, err := Open(storage.NewMemStorage(), []byte("0123456789abcdef0123456789abcdef"), nil)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer db.Close()
+
+	keys := []string{"aa", "ab", "ac", "b"}
+	for _, k := range keys {
+		if err := db.Put([]byte(k), []byte("v:"+k), nil); err != nil {
+			t.Fatalf("Put(%q): %s", k, err)
+		}
+	}
+
+	it := db.NewIterator(&util.Range{Start: []byte("aa"), Limit: nil}, nil)
+	defer it.Release()
+
+	var got []string
+	for it.Next() {
+		got = append(got, string(it.Key()))
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iterator error: %s", err)
+	}
+
+	want := make([]string, len(keys))
+	copy(want, keys)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("got %d keys, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("mismatch at %d: got %q, want %q (full: %v)", i, got[i], want[i], got)
+		}
+	}
+}
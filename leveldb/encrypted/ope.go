@@ -0,0 +1,43 @@
+package encrypted
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// opeTable builds a strictly increasing, keyed mapping from a plaintext
+// byte to a wider (uint16) ciphertext value, for one byte position of the
+// key prefix. A monotonic bijection on a fixed-size ordered domain is
+// forced to be the identity, so true order-preserving encryption has to
+// expand the range instead: each table entry is the cumulative sum of
+// keyed pseudo-random positive gaps, which is monotonic by construction
+// while still hiding the exact input value within its gap.
+//
+// Because the same table is reused for every key at a given position,
+// comparing two encrypted prefixes byte-position by byte-position yields
+// the same order as comparing the original prefixes lexicographically -
+// which is the whole point: it lets LevelDB's iterators keep working over
+// ciphertext without ever seeing the plaintext key.
+func opeTable(key []byte, pos int) [256]uint16 {
+	var table [256]uint16
+	var cum uint32
+	mac := hmac.New(sha256.New, key)
+	for b := 0; b < 256; b++ {
+		mac.Reset()
+		mac.Write([]byte{byte(pos), byte(b)})
+		sum := mac.Sum(nil)
+		gap := 1 + uint32(binary.BigEndian.Uint16(sum[:2])%256)
+		cum += gap
+		table[b] = uint16(cum)
+	}
+	return table
+}
+
+func invertOPETable(table [256]uint16) map[uint16]byte {
+	inv := make(map[uint16]byte, 256)
+	for b, v := range table {
+		inv[v] = byte(b)
+	}
+	return inv
+}
@@ -0,0 +1,24 @@
+package encrypted
+
+import "testing"
+
+// TestOptionsWithDefaultsSentinels checks that 0 picks the documented
+// defaults and -1 actually disables PrefixLen/LengthBucket, since plain 0
+// can't mean both "unset" and "disabled" at once.
+func TestOptionsWithDefaultsSentinels(t *testing.T) {
+	def := (&Options{}).withDefaults()
+	if def.PrefixLen != defaultPrefixLen {
+		t.Fatalf("zero-value PrefixLen: got %d, want default %d", def.PrefixLen, defaultPrefixLen)
+	}
+	if def.LengthBucket != defaultLengthBucket {
+		t.Fatalf("zero-value LengthBucket: got %d, want default %d", def.LengthBucket, defaultLengthBucket)
+	}
+
+	disabled := (&Options{PrefixLen: -1, LengthBucket: -1}).withDefaults()
+	if disabled.PrefixLen != 0 {
+		t.Fatalf("PrefixLen: -1 did not disable, got %d", disabled.PrefixLen)
+	}
+	if disabled.LengthBucket != 0 {
+		t.Fatalf("LengthBucket: -1 did not disable, got %d", disabled.LengthBucket)
+	}
+}
@@ -0,0 +1,130 @@
+package encrypted
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// TestEncryptKeyOrderPreserving is a regression test for a bug where a raw
+// length byte prefixed before the OPE-encoded bytes dominated
+// Comparer.Compare's plain bytes.Compare, inverting iteration order for
+// keys of different lengths relative to PrefixLen. It reproduces the
+// reported case directly against encryptKey (prefixLen=8, "b" vs
+// "aaaaaaaa") and then checks a wider mix of lengths. Only the first
+// prefixLen bytes are order-preserving: keys that share that whole prefix
+// sort by their opaque suffix ciphertext, so the mix is checked for
+// plaintext order over that prefix.
+func TestEncryptKeyOrderPreserving(t *testing.T) {
+	db := &DB{
+		keyHMACKey: []byte("order-preserving-test-key-nonce"),
+		prefixLen:  8,
+	}
+	aead, err := storage.DefaultSuite().New([]byte("order-preserving-test-aead-key!!"))
+	if err != nil {
+		t.Fatalf("aead: %s", err)
+	}
+	db.aead = aead
+	opeKey := []byte("order-preserving-test-ope-key!!")
+	db.opeTables = make([][256]uint16, db.prefixLen)
+	db.opeInv = make([]map[uint16]byte, db.prefixLen)
+	for i := 0; i < db.prefixLen; i++ {
+		db.opeTables[i] = opeTable(opeKey, i)
+		db.opeInv[i] = invertOPETable(db.opeTables[i])
+	}
+
+	a, b := []byte("aaaaaaaa"), []byte("b")
+	if bytes.Compare(b, a) <= 0 {
+		t.Fatalf("test precondition broken: expected %q > %q", b, a)
+	}
+	if got := bytes.Compare(db.encryptKey(b), db.encryptKey(a)); got <= 0 {
+		t.Fatalf("encryptKey(%q) vs encryptKey(%q): got Compare=%d, want > 0 (order not preserved)", b, a, got)
+	}
+
+	keys := [][]byte{
+		[]byte(""),
+		[]byte("a"),
+		[]byte("aa"),
+		[]byte("ab"),
+		[]byte("aaaaaaaa"),
+		[]byte("aaaaaaaaa"),
+		[]byte("aaaaaaaax"),
+		[]byte("b"),
+		[]byte("ba"),
+		[]byte("zzzzzzzzzzzz"),
+	}
+	sorted := make([][]byte, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+
+	encoded := make([][]byte, len(keys))
+	for i, k := range keys {
+		encoded[i] = db.encryptKey(k)
+	}
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return bytes.Compare(encoded[order[i]], encoded[order[j]]) < 0 })
+	for i, o := range order {
+		if !bytes.Equal(keyPrefix(keys[o], db.prefixLen), keyPrefix(sorted[i], db.prefixLen)) {
+			t.Fatalf("encrypted order mismatch at %d: got %q, want %q", i, keys[o], sorted[i])
+		}
+	}
+}
+
+// keyPrefix returns the leading bytes of k that encryptKey encodes in
+// order-preserving form.
+func keyPrefix(k []byte, prefixLen int) []byte {
+	if len(k) > prefixLen {
+		return k[:prefixLen]
+	}
+	return k
+}
+
+// TestOpenIterationOrder is an end-to-end check that the same property
+// holds through Open/Put/NewIterator, not just encryptKey in isolation,
+// and that every key comes back exactly once.
+func TestOpenIterationOrder(t *testing.T) {
+	db, err := Open(storage.NewMemStorage(), []byte("0123456789abcdef0123456789abcdef"), nil)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer db.Close()
+
+	keys := []string{"b", "aaaaaaaa", "aaaaaaaaa", "a", "aaaaaaaax", "zz"}
+	for _, k := range keys {
+		if err := db.Put([]byte(k), []byte("v:"+k), nil); err != nil {
+			t.Fatalf("Put(%q): %s", k, err)
+		}
+	}
+	want := make([]string, len(keys))
+	copy(want, keys)
+	sort.Strings(want)
+
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	var got []string
+	for it.Next() {
+		got = append(got, string(it.Key()))
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iterator error: %s", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d keys, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !bytes.Equal(keyPrefix([]byte(got[i]), defaultPrefixLen), keyPrefix([]byte(want[i]), defaultPrefixLen)) {
+			t.Fatalf("iteration order mismatch at %d: got %q, want %q (full: %v)", i, got[i], want[i], got)
+		}
+	}
+	sort.Strings(got)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("key set mismatch at %d: got %q, want %q (full: %v)", i, got[i], want[i], got)
+		}
+	}
+}
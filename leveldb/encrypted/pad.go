@@ -0,0 +1,25 @@
+package encrypted
+
+import "encoding/binary"
+
+// padToBucket prepends data's true length (so unpad can recover it exactly)
+// and zero-pads the result up to the next multiple of bucket bytes. Rounding
+// every value up to a shared size reduces, without eliminating, the amount
+// an observer can infer about a key's suffix or a value from its stored
+// length; bucket == 0 disables padding.
+func padToBucket(data []byte, bucket int) []byte {
+	body := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(body, uint32(len(data)))
+	copy(body[4:], data)
+	if bucket > 1 {
+		if rem := len(body) % bucket; rem != 0 {
+			body = append(body, make([]byte, bucket-rem)...)
+		}
+	}
+	return body
+}
+
+func unpad(body []byte) []byte {
+	n := binary.BigEndian.Uint32(body[:4])
+	return body[4 : 4+n]
+}
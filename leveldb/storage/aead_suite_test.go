@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/cpu"
+)
+
+func TestSuiteByNameUnknown(t *testing.T) {
+	if _, err := SuiteByName("not-a-real-suite"); err == nil {
+		t.Fatalf("SuiteByName: expected error for unknown suite name")
+	}
+}
+
+func TestSuiteByNameKnown(t *testing.T) {
+	for _, suite := range []AEADSuite{
+		aesGCMSuite{},
+		aesGCMSIVSuite{},
+		chacha20poly1305Suite{},
+		xchacha20poly1305Suite{},
+	} {
+		got, err := SuiteByName(suite.Name())
+		if err != nil {
+			t.Fatalf("SuiteByName(%q): %s", suite.Name(), err)
+		}
+		if got.Name() != suite.Name() {
+			t.Fatalf("SuiteByName(%q): got suite named %q", suite.Name(), got.Name())
+		}
+	}
+}
+
+// TestDefaultSuite checks DefaultSuite picks the suite its own doc comment
+// promises for whichever CPU this test happens to run on, rather than
+// exercising just one branch of the AES-NI check.
+func TestDefaultSuite(t *testing.T) {
+	want := "chacha20-poly1305"
+	if cpu.X86.HasAES || cpu.ARM64.HasAES {
+		want = "aes256-gcm"
+	}
+	if got := DefaultSuite().Name(); got != want {
+		t.Fatalf("DefaultSuite: got %q, want %q", got, want)
+	}
+}
+
+// TestAEADSuiteRoundTrip writes plaintext spanning multiple blocks through
+// NewBenchFileWrap under each AEADSuite other than aesGCMSuite and checks it decrypts
+// back unchanged, the same property TestEncFileWrapRoundTrip already
+// establishes for aesGCMSuite.
+func TestAEADSuiteRoundTrip(t *testing.T) {
+	for _, suite := range []AEADSuite{
+		aesGCMSIVSuite{},
+		chacha20poly1305Suite{},
+		xchacha20poly1305Suite{},
+	} {
+		suite := suite
+		t.Run(suite.Name(), func(t *testing.T) {
+			f, err := ioutil.TempFile("", "aead_suite_test")
+			if err != nil {
+				t.Fatalf("TempFile: %s", err)
+			}
+			name := f.Name()
+			defer os.Remove(name)
+
+			key := make([]byte, suite.KeySize())
+			if _, err := rand.New(rand.NewSource(1)).Read(key); err != nil {
+				t.Fatalf("rand: %s", err)
+			}
+			fw, err := NewBenchFileWrap(f, suite, key)
+			if err != nil {
+				t.Fatalf("NewBenchFileWrap: %s", err)
+			}
+
+			plain := make([]byte, encBlockSize*3+17)
+			if _, err := rand.New(rand.NewSource(2)).Read(plain); err != nil {
+				t.Fatalf("rand: %s", err)
+			}
+			if _, err := fw.WriteAt(plain, 0); err != nil {
+				t.Fatalf("WriteAt: %s", err)
+			}
+			if err := fw.Close(); err != nil {
+				t.Fatalf("Close: %s", err)
+			}
+
+			f2, err := os.OpenFile(name, os.O_RDWR, 0600)
+			if err != nil {
+				t.Fatalf("OpenFile: %s", err)
+			}
+			fw2, err := NewBenchFileWrap(f2, suite, key)
+			if err != nil {
+				t.Fatalf("reopen: %s", err)
+			}
+			defer fw2.Close()
+
+			got := make([]byte, len(plain))
+			if _, err := fw2.ReadAt(got, 0); err != nil {
+				t.Fatalf("ReadAt: %s", err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Fatalf("round trip mismatch under %s", suite.Name())
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Command bench measures the throughput of each AEADSuite supported by
+// leveldb/storage, so an operator can pick a cipher based on the hardware
+// the database will actually run on rather than guessing.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+const (
+	totalSize  = 64 << 20 // 64 MiB per workload
+	writeChunk = 64 << 10 // 64 KiB per sequential Write call
+	readChunk  = 4 << 10  // 4 KiB per random ReadAt call
+)
+
+func main() {
+	dir := flag.String("dir", "", "scratch directory (defaults to a temp dir)")
+	flag.Parse()
+
+	scratch := *dir
+	if scratch == "" {
+		d, err := ioutil.TempDir("", "leveldb-bench")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bench: %s\n", err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(d)
+		scratch = d
+	}
+
+	suites := []storage.AEADSuite{}
+	for _, name := range []string{
+		"aes256-gcm",
+		"aes256-gcm-siv",
+		"chacha20-poly1305",
+		"xchacha20-poly1305",
+	} {
+		suite, err := storage.SuiteByName(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bench: %s\n", err)
+			os.Exit(1)
+		}
+		suites = append(suites, suite)
+	}
+
+	fmt.Printf("%-20s %14s %14s %14s\n", "suite", "seq write", "random read", "compaction")
+	for _, suite := range suites {
+		seq, err := runSequentialWrite(scratch, suite)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bench: %s: sequential write: %s\n", suite.Name(), err)
+			continue
+		}
+		rnd, err := runRandomRead(scratch, suite)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bench: %s: random read: %s\n", suite.Name(), err)
+			continue
+		}
+		compaction, err := runCompaction(scratch, suite)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bench: %s: compaction: %s\n", suite.Name(), err)
+			continue
+		}
+		fmt.Printf("%-20s %11.1f MB/s %11.1f MB/s %11.1f MB/s\n", suite.Name(), seq, rnd, compaction)
+	}
+}
+
+func runSequentialWrite(scratch string, suite storage.AEADSuite) (float64, error) {
+	key := make([]byte, suite.KeySize())
+	path := scratch + "/" + suite.Name() + ".seq"
+	of, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer of.Close()
+
+	fw, err := storage.NewBenchFileWrap(of, suite, key)
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, writeChunk)
+	start := time.Now()
+	for written := 0; written < totalSize; written += writeChunk {
+		if _, err := fw.Write(buf); err != nil {
+			return 0, err
+		}
+	}
+	elapsed := time.Since(start).Seconds()
+	return float64(totalSize) / (1 << 20) / elapsed, nil
+}
+
+func runRandomRead(scratch string, suite storage.AEADSuite) (float64, error) {
+	key := make([]byte, suite.KeySize())
+	path := scratch + "/" + suite.Name() + ".rnd"
+	of, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer of.Close()
+
+	fw, err := storage.NewBenchFileWrap(of, suite, key)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := fw.Write(make([]byte, totalSize)); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, readChunk)
+	reads := totalSize / readChunk
+	start := time.Now()
+	for i := 0; i < reads; i++ {
+		off := int64(rand.Intn(totalSize-readChunk)) &^ (readChunk - 1)
+		if _, err := fw.ReadAt(buf, off); err != nil {
+			return 0, err
+		}
+	}
+	elapsed := time.Since(start).Seconds()
+	return float64(reads*readChunk) / (1 << 20) / elapsed, nil
+}
+
+// runCompaction approximates the I/O shape of a compaction: many small
+// table-sized files get written once and then read back sequentially in
+// full, as a compaction would when merging them into the next level.
+func runCompaction(scratch string, suite storage.AEADSuite) (float64, error) {
+	const (
+		tableSize = 2 << 20 // 2 MiB tables, like the default goleveldb table size
+		numTables = totalSize / tableSize
+	)
+	key := make([]byte, suite.KeySize())
+	buf := make([]byte, tableSize)
+
+	start := time.Now()
+	for i := 0; i < numTables; i++ {
+		path := fmt.Sprintf("%s/%s.table%d", scratch, suite.Name(), i)
+		of, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return 0, err
+		}
+		fw, err := storage.NewBenchFileWrap(of, suite, key)
+		if err != nil {
+			of.Close()
+			return 0, err
+		}
+		if _, err := fw.Write(buf); err != nil {
+			of.Close()
+			return 0, err
+		}
+		if _, err := fw.ReadAt(buf, 0); err != nil {
+			of.Close()
+			return 0, err
+		}
+		of.Close()
+	}
+	elapsed := time.Since(start).Seconds()
+	return float64(numTables*tableSize*2) / (1 << 20) / elapsed, nil
+}
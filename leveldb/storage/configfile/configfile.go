@@ -0,0 +1,271 @@
+// Package configfile manages the on-disk configuration that accompanies an
+// encrypted LevelDB directory, analogous to gocryptfs' gocryptfs.conf: it
+// stores the KDF parameters needed to turn a passphrase into a
+// key-encryption-key (KEK), the master key wrapped under that KEK, and the
+// set of format feature flags the database was created with.
+//
+// The master key, not the passphrase, is what actually encrypts database
+// files; the passphrase only ever protects the wrapped master key, which
+// is why ChangePassphrase can rewrap it without touching any database file.
+package configfile
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// FileName is the config file name created alongside the encrypted
+// database directory.
+const FileName = "leveldb.conf"
+
+const (
+	masterKeySize = 32
+	kekSize       = 32
+	saltSize      = 16
+)
+
+// Known feature flags. A config listing a flag this package doesn't
+// recognize fails to load with a clear error rather than silently
+// ignoring it, so future format changes can be introduced safely.
+// These mirror the AEADSuite.Name() values in package storage; the config
+// file only ever lists one of them (the cipher the database was created
+// with), but they all have to be recognized here so Load can tell an
+// unsupported cipher apart from a malformed or genuinely unknown flag.
+const (
+	FeatureAES256GCM         = "aes256-gcm"
+	FeatureAES256GCMSIV      = "aes256-gcm-siv"
+	FeatureChaCha20Poly1305  = "chacha20-poly1305"
+	FeatureXChaCha20Poly1305 = "xchacha20-poly1305"
+)
+
+var knownFeatures = map[string]bool{
+	FeatureAES256GCM:         true,
+	FeatureAES256GCMSIV:      true,
+	FeatureChaCha20Poly1305:  true,
+	FeatureXChaCha20Poly1305: true,
+}
+
+// KDFParams describes how the KEK is derived from a passphrase.
+type KDFParams struct {
+	Algorithm string `json:"algorithm"` // "scrypt" or "argon2id"
+	Salt      []byte `json:"salt"`
+
+	// scrypt parameters.
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+
+	// argon2id parameters.
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+}
+
+// EncryptedKey is the master key sealed with AES-GCM under the KEK.
+type EncryptedKey struct {
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Config is the JSON document persisted as leveldb.conf.
+type Config struct {
+	Version      int          `json:"version"`
+	KDF          KDFParams    `json:"kdf"`
+	Features     []string     `json:"features"`
+	EncryptedKey EncryptedKey `json:"encrypted_key"`
+}
+
+func defaultKDFParams() (KDFParams, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return KDFParams{}, fmt.Errorf("configfile: failed to generate salt: %s", err)
+	}
+	return KDFParams{
+		Algorithm: "scrypt",
+		Salt:      salt,
+		N:         1 << 15,
+		R:         8,
+		P:         1,
+	}, nil
+}
+
+func deriveKEK(passphrase []byte, kdf KDFParams) ([]byte, error) {
+	switch kdf.Algorithm {
+	case "scrypt":
+		return scrypt.Key(passphrase, kdf.Salt, kdf.N, kdf.R, kdf.P, kekSize)
+	case "argon2id":
+		return argon2.IDKey(passphrase, kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads, kekSize), nil
+	default:
+		return nil, fmt.Errorf("configfile: unknown kdf algorithm: %q", kdf.Algorithm)
+	}
+}
+
+func wrapMasterKey(masterKey, kek []byte) (EncryptedKey, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return EncryptedKey{}, fmt.Errorf("configfile: failed to init cipher: %s", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return EncryptedKey{}, fmt.Errorf("configfile: failed to init AEAD: %s", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return EncryptedKey{}, fmt.Errorf("configfile: failed to generate nonce: %s", err)
+	}
+	ct := aead.Seal(nil, nonce, masterKey, nil)
+	return EncryptedKey{Nonce: nonce, Ciphertext: ct}, nil
+}
+
+func unwrapMasterKey(ek EncryptedKey, kek []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("configfile: failed to init cipher: %s", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("configfile: failed to init AEAD: %s", err)
+	}
+	masterKey, err := aead.Open(nil, ek.Nonce, ek.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("configfile: wrong passphrase or corrupted config: %s", err)
+	}
+	return masterKey, nil
+}
+
+func checkFeatures(cfg *Config) error {
+	for _, f := range cfg.Features {
+		if !knownFeatures[f] {
+			return fmt.Errorf("configfile: unknown required feature flag %q", f)
+		}
+	}
+	return nil
+}
+
+func path(dir string) string {
+	return filepath.Join(dir, FileName)
+}
+
+func load(dir string) (*Config, error) {
+	data, err := ioutil.ReadFile(path(dir))
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("configfile: malformed config: %s", err)
+	}
+	return cfg, nil
+}
+
+func save(dir string, cfg *Config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("configfile: failed to marshal config: %s", err)
+	}
+	return ioutil.WriteFile(path(dir), data, 0600)
+}
+
+// Create generates a fresh random master key, wraps it under a KEK derived
+// from passphrase, and writes dir/leveldb.conf. It fails if a config
+// already exists in dir.
+func Create(dir string, passphrase []byte, features []string) (masterKey []byte, err error) {
+	if _, err := os.Stat(path(dir)); err == nil {
+		return nil, fmt.Errorf("configfile: %s already exists", path(dir))
+	}
+
+	kdf, err := defaultKDFParams()
+	if err != nil {
+		return nil, err
+	}
+	kek, err := deriveKEK(passphrase, kdf)
+	if err != nil {
+		return nil, err
+	}
+
+	masterKey = make([]byte, masterKeySize)
+	if _, err := rand.Read(masterKey); err != nil {
+		return nil, fmt.Errorf("configfile: failed to generate master key: %s", err)
+	}
+	ek, err := wrapMasterKey(masterKey, kek)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		Version:      1,
+		KDF:          kdf,
+		Features:     features,
+		EncryptedKey: ek,
+	}
+	if err := checkFeatures(cfg); err != nil {
+		return nil, err
+	}
+	if err := save(dir, cfg); err != nil {
+		return nil, err
+	}
+	return masterKey, nil
+}
+
+// Peek reads dir/leveldb.conf without unwrapping the master key, for
+// tooling that only needs the cleartext metadata (KDF parameters, feature
+// flags) and has no passphrase.
+func Peek(dir string) (*Config, error) {
+	return load(dir)
+}
+
+// Load reads dir/leveldb.conf and unwraps the master key using passphrase.
+func Load(dir string, passphrase []byte) (masterKey []byte, cfg *Config, err error) {
+	cfg, err = load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkFeatures(cfg); err != nil {
+		return nil, nil, err
+	}
+	kek, err := deriveKEK(passphrase, cfg.KDF)
+	if err != nil {
+		return nil, nil, err
+	}
+	masterKey, err = unwrapMasterKey(cfg.EncryptedKey, kek)
+	if err != nil {
+		return nil, nil, err
+	}
+	return masterKey, cfg, nil
+}
+
+// ChangePassphrase rewraps the existing master key under a KEK derived from
+// newPassphrase, with a freshly generated salt. The master key itself, and
+// therefore every encrypted database file, is left untouched.
+func ChangePassphrase(dir string, oldPassphrase, newPassphrase []byte) error {
+	masterKey, cfg, err := Load(dir, oldPassphrase)
+	if err != nil {
+		return err
+	}
+
+	kdf, err := defaultKDFParams()
+	if err != nil {
+		return err
+	}
+	kek, err := deriveKEK(newPassphrase, kdf)
+	if err != nil {
+		return err
+	}
+	ek, err := wrapMasterKey(masterKey, kek)
+	if err != nil {
+		return err
+	}
+
+	cfg.KDF = kdf
+	cfg.EncryptedKey = ek
+	return save(dir, cfg)
+}
@@ -0,0 +1,72 @@
+package configfile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "configfile_test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// TestCreateLoadRoundTrip checks that Load recovers the exact master key
+// Create generated, given the right passphrase, and rejects the wrong one.
+func TestCreateLoadRoundTrip(t *testing.T) {
+	dir := tempDir(t)
+	passphrase := []byte("correct horse battery staple")
+
+	created, err := Create(dir, passphrase, []string{FeatureAES256GCM})
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	loaded, _, err := Load(dir, passphrase)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if !bytes.Equal(created, loaded) {
+		t.Fatalf("Load returned a different master key than Create generated")
+	}
+
+	if _, _, err := Load(dir, []byte("wrong passphrase")); err == nil {
+		t.Fatalf("Load with the wrong passphrase unexpectedly succeeded")
+	}
+}
+
+// TestChangePassphraseRewrap checks that ChangePassphrase lets the master
+// key be recovered under the new passphrase, no longer under the old one,
+// while leaving the master key itself unchanged.
+func TestChangePassphraseRewrap(t *testing.T) {
+	dir := tempDir(t)
+	oldPassphrase := []byte("old passphrase")
+	newPassphrase := []byte("new passphrase")
+
+	masterKey, err := Create(dir, oldPassphrase, []string{FeatureAES256GCM})
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	if err := ChangePassphrase(dir, oldPassphrase, newPassphrase); err != nil {
+		t.Fatalf("ChangePassphrase: %s", err)
+	}
+
+	rewrapped, _, err := Load(dir, newPassphrase)
+	if err != nil {
+		t.Fatalf("Load with new passphrase: %s", err)
+	}
+	if !bytes.Equal(masterKey, rewrapped) {
+		t.Fatalf("master key changed across ChangePassphrase")
+	}
+
+	if _, _, err := Load(dir, oldPassphrase); err == nil {
+		t.Fatalf("Load with the old passphrase unexpectedly succeeded after ChangePassphrase")
+	}
+}
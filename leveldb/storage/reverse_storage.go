@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrReadOnly is returned by any mutating operation on a read-only Storage,
+// such as ReverseStorage.
+var ErrReadOnly = errors.New("storage: read-only")
+
+// ReverseStorage presents a read-only encrypted view of a plaintext
+// LevelDB directory, analogous to gocryptfs-reverse: it never stores
+// anything itself, it derives the encrypted bytes of each underlying file
+// on demand. Because the mapping from plaintext to ciphertext is
+// deterministic (same file, same content -> same bytes), a backup agent
+// can stream ReverseStorage's output to remote storage and restore it with
+// a plain byte copy followed by a normal OpenEncryptedFile.
+//
+// Determinism is achieved by deriving the nonce for each block from
+// HMAC(fileID||blockNumber) instead of drawing it at random, which means
+// the same (fileID, blockNumber, plaintext) triple always seals to the
+// same ciphertext. That is only safe against nonce reuse if the triple
+// never changes meaning under the same key, which is why NewReverseStorage
+// defaults to AES-256-GCM-SIV: unlike plain AES-GCM it degrades gracefully,
+// rather than leaking the authentication key, if a block is ever
+// reverse-encrypted twice with different plaintext under the same nonce.
+type ReverseStorage struct {
+	underlying Storage
+	aead       cipher.AEAD
+	hmacKey    []byte
+}
+
+// NewReverseStorage wraps underlying (the plaintext database directory)
+// with a deterministic encrypted read-only view sealed under key, using
+// suite (nil selects AES-256-GCM-SIV). key is used exactly as
+// NewEncryptedFileStorage/OpenEncryptedFile use it, so the straight byte
+// copy this type promises can be restored with those entry points and the
+// same key — no subkey derivation to reproduce on the restore side.
+func NewReverseStorage(underlying Storage, suite AEADSuite, key []byte) (*ReverseStorage, error) {
+	if suite == nil {
+		suite = aesGCMSIVSuite{}
+	}
+	if len(key) != suite.KeySize() {
+		return nil, fmt.Errorf("%s needs a %d-byte key, got %d bytes", suite.Name(), suite.KeySize(), len(key))
+	}
+	hmacKey := deriveSubkey(key, "leveldb-reverse-nonce")
+
+	aead, err := suite.New(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init %s: %s", suite.Name(), err)
+	}
+	return &ReverseStorage{underlying: underlying, aead: aead, hmacKey: hmacKey}, nil
+}
+
+func deriveSubkey(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+func (s *ReverseStorage) deriveFileID(fd FileDesc) [encFileIDSize]byte {
+	var id [encFileIDSize]byte
+	sum := deriveSubkey(s.hmacKey, fd.String())
+	copy(id[:], sum)
+	return id
+}
+
+func (s *ReverseStorage) deriveNonce(fileID [encFileIDSize]byte, blockNum int64) []byte {
+	mac := hmac.New(sha256.New, s.hmacKey)
+	mac.Write(blockAAD(fileID, blockNum))
+	return mac.Sum(nil)[:s.aead.NonceSize()]
+}
+
+func (s *ReverseStorage) Lock() (Locker, error)                { return s.underlying.Lock() }
+func (s *ReverseStorage) Log(str string)                       { s.underlying.Log(str) }
+func (s *ReverseStorage) GetMeta() (FileDesc, error)           { return s.underlying.GetMeta() }
+func (s *ReverseStorage) List(ft FileType) ([]FileDesc, error) { return s.underlying.List(ft) }
+func (s *ReverseStorage) Close() error                         { return s.underlying.Close() }
+
+func (s *ReverseStorage) SetMeta(fd FileDesc) error          { return ErrReadOnly }
+func (s *ReverseStorage) Create(fd FileDesc) (Writer, error) { return nil, ErrReadOnly }
+func (s *ReverseStorage) Remove(fd FileDesc) error           { return ErrReadOnly }
+func (s *ReverseStorage) Rename(oldfd, newfd FileDesc) error { return ErrReadOnly }
+
+func (s *ReverseStorage) Open(fd FileDesc) (Reader, error) {
+	r, err := s.underlying.Open(fd)
+	if err != nil {
+		return nil, err
+	}
+	plainSize, err := r.Seek(0, os.SEEK_END)
+	if err != nil {
+		return nil, err
+	}
+	return &reverseFileReader{
+		underlying: r,
+		storage:    s,
+		fileID:     s.deriveFileID(fd),
+		plainSize:  plainSize,
+	}, nil
+}
+
+// reverseFileReader presents the virtual encrypted bytes of a single
+// plaintext file. Nothing is cached on disk: each read re-derives the
+// ciphertext of the blocks it covers from the live plaintext.
+type reverseFileReader struct {
+	underlying Reader
+	storage    *ReverseStorage
+	fileID     [encFileIDSize]byte
+	plainSize  int64
+	pos        int64
+	closed     bool
+}
+
+func (r *reverseFileReader) header() []byte {
+	hdr := make([]byte, encHeaderSize)
+	binary.BigEndian.PutUint16(hdr, encFormatVersion1)
+	copy(hdr[2:], r.fileID[:])
+	return hdr
+}
+
+func (r *reverseFileReader) fullBlockCTSize() int64 {
+	return int64(r.storage.aead.NonceSize() + encBlockSize + r.storage.aead.Overhead())
+}
+
+// blockCiphertext deterministically re-derives the ciphertext of block
+// blockNum from the underlying plaintext.
+func (r *reverseFileReader) blockCiphertext(blockNum int64) ([]byte, error) {
+	plainLen := blockPlainLen(blockNum, r.plainSize)
+	if plainLen == 0 {
+		return nil, nil
+	}
+	plain := make([]byte, plainLen)
+	if _, err := r.underlying.ReadAt(plain, blockNum*encBlockSize); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read underlying block %d failed: %s", blockNum, err)
+	}
+
+	nonce := r.storage.deriveNonce(r.fileID, blockNum)
+	nonceSize := r.storage.aead.NonceSize()
+	buf := make([]byte, nonceSize, nonceSize+plainLen+r.storage.aead.Overhead())
+	copy(buf, nonce)
+	return r.storage.aead.Seal(buf, nonce, plain, blockAAD(r.fileID, blockNum)), nil
+}
+
+func (r *reverseFileReader) virtualSize() int64 {
+	full := r.plainSize / encBlockSize
+	rem := r.plainSize % encBlockSize
+	size := encHeaderSize + full*r.fullBlockCTSize()
+	if rem > 0 {
+		size += int64(r.storage.aead.NonceSize()) + rem + int64(r.storage.aead.Overhead())
+	}
+	return size
+}
+
+func (r *reverseFileReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.virtualSize() {
+		return 0, io.EOF
+	}
+	var read int
+	for read < len(p) {
+		pos := off + int64(read)
+		if pos >= r.virtualSize() {
+			break
+		}
+		if pos < encHeaderSize {
+			hdr := r.header()
+			read += copy(p[read:], hdr[pos:])
+			continue
+		}
+		blockNum := (pos - encHeaderSize) / r.fullBlockCTSize()
+		blockStart := encHeaderSize + blockNum*r.fullBlockCTSize()
+		blockOff := pos - blockStart
+
+		ct, err := r.blockCiphertext(blockNum)
+		if err != nil {
+			return read, err
+		}
+		if blockOff >= int64(len(ct)) {
+			break
+		}
+		read += copy(p[read:], ct[blockOff:])
+	}
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+func (r *reverseFileReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *reverseFileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case os.SEEK_SET:
+		r.pos = offset
+	case os.SEEK_CUR:
+		r.pos += offset
+	case os.SEEK_END:
+		r.pos = r.virtualSize() + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	return r.pos, nil
+}
+
+func (r *reverseFileReader) Close() error {
+	if r.closed {
+		return ErrClosed
+	}
+	r.closed = true
+	return r.underlying.Close()
+}
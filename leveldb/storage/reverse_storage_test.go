@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestNewReverseStorageShortKey checks that a key shorter than the
+// suite's key size is rejected with an error, not a slice-bounds panic.
+func TestNewReverseStorageShortKey(t *testing.T) {
+	if _, err := NewReverseStorage(NewMemStorage(), nil, make([]byte, 16)); err == nil {
+		t.Fatalf("NewReverseStorage: expected error for undersized key, got nil")
+	}
+}
+
+// TestReverseStorageDeterministic checks that encrypting the same
+// plaintext file twice through ReverseStorage yields byte-identical
+// ciphertext, which is the property backup streaming depends on.
+func TestReverseStorageDeterministic(t *testing.T) {
+	mem := NewMemStorage()
+	fd := FileDesc{Type: TypeTable, Num: 1}
+	w, err := mem.Create(fd)
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	plain := bytes.Repeat([]byte("reverse-storage-test-"), 500)
+	if _, err := w.Write(plain); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	key := bytes.Repeat([]byte{0x42}, 32)
+	rs, err := NewReverseStorage(mem, nil, key)
+	if err != nil {
+		t.Fatalf("NewReverseStorage: %s", err)
+	}
+
+	readAll := func() []byte {
+		r, err := rs.Open(fd)
+		if err != nil {
+			t.Fatalf("Open: %s", err)
+		}
+		defer r.Close()
+		size, err := r.Seek(0, os.SEEK_END)
+		if err != nil {
+			t.Fatalf("Seek: %s", err)
+		}
+		buf := make([]byte, size)
+		if _, err := r.ReadAt(buf, 0); err != nil {
+			t.Fatalf("ReadAt: %s", err)
+		}
+		return buf
+	}
+
+	a, b := readAll(), readAll()
+	if !bytes.Equal(a, b) {
+		t.Fatalf("reverse-encrypted bytes differ between two reads of the same plaintext")
+	}
+
+	// The encrypted form must actually decrypt back to the original
+	// plaintext against a plain encFileWrap using the same key passed to
+	// NewReverseStorage, unmodified: proves a backup agent can restore a
+	// ReverseStorage stream with the same key it was produced under,
+	// through the same exported entry points the forward path uses, not
+	// just that the bytes are internally self-consistent.
+	tmp, err := ioutil.TempFile("", "reverse_storage_test")
+	if err != nil {
+		t.Fatalf("TempFile: %s", err)
+	}
+	name := tmp.Name()
+	defer os.Remove(name)
+	if _, err := tmp.Write(a); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if err := tmp.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	f, err := os.OpenFile(name, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatalf("OpenFile: %s", err)
+	}
+	suite := aesGCMSIVSuite{}
+	fw, err := NewBenchFileWrap(f, suite, key[:suite.KeySize()])
+	if err != nil {
+		t.Fatalf("NewBenchFileWrap: %s", err)
+	}
+	defer fw.Close()
+
+	got := make([]byte, len(plain))
+	if _, err := fw.ReadAt(got, 0); err != nil {
+		t.Fatalf("ReadAt: %s", err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatalf("decrypted reverse-encrypted bytes do not match original plaintext")
+	}
+}